@@ -0,0 +1,453 @@
+// Package client is a reconnect-friendly SDK for pub-sub-go's WebSocket API.
+// It wraps nhooyr.io/websocket, transparently reconnects with jittered
+// exponential backoff, and resumes subscriptions from the last seen
+// sequence number after a drop.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// Message is a message delivered on a topic.
+type Message struct {
+	ID      string
+	Payload any
+	Seq     int64
+	Ts      time.Time
+}
+
+// Ack is the result of a successful Publish.
+type Ack struct {
+	Topic string
+	TS    time.Time
+}
+
+// Options configures a Client.
+type Options struct {
+	URL      string // e.g. ws://localhost:8080/ws
+	APIKey   string
+	ClientID string // defaults to a random ID if empty
+
+	// InitialBackoff and MaxBackoff bound the jittered exponential backoff
+	// used between reconnect attempts.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// PingInterval must match the server's heartbeat (20s) closely enough
+	// that the connection isn't reaped as idle.
+	PingInterval time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.ClientID == "" {
+		o.ClientID = randomID()
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 250 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 20 * time.Second
+	}
+}
+
+// SubscribeOptions configures how a subscription replays history and is
+// acknowledged.
+type SubscribeOptions struct {
+	LastN        int
+	FromSeq      int64
+	DeliveryMode string // "at_most_once" (default) or "at_least_once"
+	Group        string
+
+	// Compression requests a payload codec for this subscription's event
+	// delivery: "gzip", "deflate", or "br". Empty means uncompressed. The
+	// server only honors this above its compressionThreshold, so small
+	// payloads may still arrive uncompressed even when this is set.
+	Compression string
+}
+
+type pendingPublish struct {
+	result chan publishResult
+}
+
+type publishResult struct {
+	ack Ack
+	err error
+}
+
+// Client is a reconnecting WebSocket client for the pub-sub-go server. All
+// methods are safe for concurrent use.
+type Client struct {
+	opts   Options
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	subs    map[string]*Subscription // topic -> subscription
+	pending map[string]*pendingPublish
+	nextReq uint64
+}
+
+// New creates a Client and starts its reconnect loop in the background. The
+// loop runs until ctx is done or Close is called.
+func New(ctx context.Context, opts Options) *Client {
+	opts.setDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Client{
+		opts:    opts,
+		cancel:  cancel,
+		subs:    make(map[string]*Subscription),
+		pending: make(map[string]*pendingPublish),
+	}
+	go c.run(ctx)
+	return c
+}
+
+// Close stops the reconnect loop and closes the current connection, if any.
+func (c *Client) Close() {
+	c.cancel()
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close(websocket.StatusNormalClosure, "client closed")
+	}
+}
+
+func (c *Client) run(ctx context.Context) {
+	backoff := c.opts.InitialBackoff
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		conn, _, err := websocket.Dial(ctx, c.opts.URL, dialOptions(c.opts))
+		if err != nil {
+			c.broadcastErr(err)
+			if !sleepBackoff(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff, c.opts.MaxBackoff)
+			continue
+		}
+		backoff = c.opts.InitialBackoff
+
+		connCtx, cancelConn := context.WithCancel(ctx)
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+
+		c.resubscribeAll(connCtx)
+		go c.pingLoop(connCtx, conn)
+
+		c.readLoop(connCtx, conn) // blocks until the connection drops
+		cancelConn()
+
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		_ = conn.Close(websocket.StatusAbnormalClosure, "reconnecting")
+	}
+}
+
+func dialOptions(opts Options) *websocket.DialOptions {
+	if opts.APIKey == "" {
+		return nil
+	}
+	return &websocket.DialOptions{
+		HTTPHeader: map[string][]string{"X-API-Key": {opts.APIKey}},
+	}
+}
+
+func (c *Client) pingLoop(ctx context.Context, conn *websocket.Conn) {
+	t := time.NewTicker(c.opts.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			_ = wsjson.Write(ctx, conn, clientToServer{Type: "ping"})
+		}
+	}
+}
+
+func (c *Client) readLoop(ctx context.Context, conn *websocket.Conn) {
+	for {
+		var msg serverToClient
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			c.broadcastErr(err)
+			return
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) dispatch(msg serverToClient) {
+	switch msg.Type {
+	case "event":
+		c.mu.Lock()
+		sub := c.subs[msg.Topic]
+		c.mu.Unlock()
+		if sub == nil || msg.Message == nil {
+			return
+		}
+		payload, err := decodePayload(msg.Encoding, msg.Message.Payload)
+		if err != nil {
+			sub.pushErr(fmt.Errorf("client: decoding payload for %q: %w", msg.Topic, err))
+			return
+		}
+		m := Message{ID: msg.Message.ID, Payload: payload, Seq: msg.Message.Seq, Ts: msg.Message.Ts}
+		atomic.StoreInt64(&sub.lastSeq, m.Seq)
+		select {
+		case sub.messages <- m:
+		default:
+			sub.pushErr(fmt.Errorf("client: subscription to %q is not keeping up; message dropped", msg.Topic))
+		}
+	case "ack":
+		c.resolvePublish(msg.RequestID, publishResult{ack: Ack{Topic: msg.Topic, TS: msg.TS}})
+	case "error":
+		if c.resolvePublish(msg.RequestID, publishResult{err: wireErr(msg.Error)}) {
+			return
+		}
+		if msg.Topic != "" {
+			c.mu.Lock()
+			sub := c.subs[msg.Topic]
+			c.mu.Unlock()
+			if sub != nil {
+				sub.pushErr(wireErr(msg.Error))
+			}
+		}
+	}
+}
+
+// decodePayload reverses encodeForSubscriber on the server: if encoding is
+// set, payload is a base64-encoded, codec-compressed JSON blob that must be
+// decompressed and unmarshaled back into the original value. An empty
+// encoding means payload is already the delivered value as-is.
+func decodePayload(encoding string, payload any) (any, error) {
+	if encoding == "" {
+		return payload, nil
+	}
+	dec, ok := decodersByName[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload encoding %q", encoding)
+	}
+	s, ok := payload.(string)
+	if !ok {
+		return nil, fmt.Errorf("encoded payload is not a string")
+	}
+	compressed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("base64-decoding payload: %w", err)
+	}
+	raw, err := dec(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%s-decoding payload: %w", encoding, err)
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("unmarshaling decoded payload: %w", err)
+	}
+	return out, nil
+}
+
+func wireErr(e *errObj) error {
+	if e == nil {
+		return errors.New("client: unknown server error")
+	}
+	return fmt.Errorf("client: %s: %s", e.Code, e.Message)
+}
+
+func (c *Client) resolvePublish(requestID string, res publishResult) bool {
+	if requestID == "" {
+		return false
+	}
+	c.mu.Lock()
+	p, ok := c.pending[requestID]
+	if ok {
+		delete(c.pending, requestID)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	p.result <- res
+	return true
+}
+
+func (c *Client) broadcastErr(err error) {
+	c.mu.Lock()
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	c.mu.Unlock()
+	for _, s := range subs {
+		s.pushErr(err)
+	}
+}
+
+// Subscribe registers interest in topic and returns a Subscription whose
+// Messages channel receives fan-out events. The subscription survives
+// reconnects: it is automatically resent, resuming from the last seen
+// sequence number.
+func (c *Client) Subscribe(topic string, opts SubscribeOptions) (*Subscription, error) {
+	sub := &Subscription{
+		topic:    topic,
+		opts:     opts,
+		messages: make(chan Message, 256),
+		errors:   make(chan error, 16),
+	}
+	if opts.FromSeq > 0 {
+		sub.lastSeq = opts.FromSeq - 1
+	}
+
+	c.mu.Lock()
+	c.subs[topic] = sub
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil {
+		if err := c.sendSubscribe(context.Background(), conn, sub); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// Unsubscribe stops a topic subscription and closes its channels.
+func (c *Client) Unsubscribe(topic string) {
+	c.mu.Lock()
+	sub, ok := c.subs[topic]
+	conn := c.conn
+	delete(c.subs, topic)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	sub.close()
+	if conn != nil {
+		_ = wsjson.Write(context.Background(), conn, clientToServer{
+			Type: "unsubscribe", Topic: topic, ClientID: c.opts.ClientID,
+		})
+	}
+}
+
+func (c *Client) resubscribeAll(ctx context.Context) {
+	c.mu.Lock()
+	conn := c.conn
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	c.mu.Unlock()
+	for _, sub := range subs {
+		if err := c.sendSubscribe(ctx, conn, sub); err != nil {
+			sub.pushErr(err)
+		}
+	}
+}
+
+func (c *Client) sendSubscribe(ctx context.Context, conn *websocket.Conn, sub *Subscription) error {
+	frame := clientToServer{
+		Type:         "subscribe",
+		Topic:        sub.topic,
+		ClientID:     c.opts.ClientID,
+		LastN:        sub.opts.LastN,
+		DeliveryMode: sub.opts.DeliveryMode,
+		Group:        sub.opts.Group,
+		Compression:  sub.opts.Compression,
+	}
+	if seq := atomic.LoadInt64(&sub.lastSeq); seq > 0 {
+		frame.FromSeq = seq + 1
+	}
+	return wsjson.Write(ctx, conn, frame)
+}
+
+// Publish sends payload to topic and waits for the server's ack (or error,
+// or ctx to be done).
+func (c *Client) Publish(ctx context.Context, topic string, payload any) (Ack, error) {
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil {
+		c.mu.Unlock()
+		return Ack{}, errors.New("client: not connected")
+	}
+	c.nextReq++
+	reqID := fmt.Sprintf("%s-%d", c.opts.ClientID, c.nextReq)
+	p := &pendingPublish{result: make(chan publishResult, 1)}
+	c.pending[reqID] = p
+	c.mu.Unlock()
+
+	frame := clientToServer{
+		Type:      "publish",
+		Topic:     topic,
+		Message:   &wireMessage{Payload: payload},
+		RequestID: reqID,
+	}
+	if err := wsjson.Write(ctx, conn, frame); err != nil {
+		c.mu.Lock()
+		delete(c.pending, reqID)
+		c.mu.Unlock()
+		return Ack{}, err
+	}
+
+	select {
+	case res := <-p.result:
+		return res.ack, res.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, reqID)
+		c.mu.Unlock()
+		return Ack{}, ctx.Err()
+	}
+}
+
+// Publisher returns a Publisher bound to topic for repeated publishing.
+func (c *Client) Publisher(topic string) *Publisher {
+	return &Publisher{c: c, topic: topic}
+}
+
+func sleepBackoff(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextBackoff doubles d (capped at max) and applies +/-20% jitter so that
+// many reconnecting clients don't retry in lockstep.
+func nextBackoff(d, max time.Duration) time.Duration {
+	d *= 2
+	if d > max {
+		d = max
+	}
+	jitter := time.Duration(mathrand.Int63n(int64(d)/5 + 1))
+	if mathrand.Intn(2) == 0 {
+		return d + jitter
+	}
+	return d - jitter
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// decoder decompresses a payload that the server compressed with the
+// matching codec (see encodeForSubscriber in the server's codec.go). Only
+// decoding is needed client-side: Subscribe negotiates a codec for event
+// delivery, but Publish always sends payloads uncompressed.
+type decoder func([]byte) ([]byte, error)
+
+var decodersByName = map[string]decoder{
+	"gzip":    decodeGzip,
+	"deflate": decodeDeflate,
+	"br":      decodeBrotli,
+}
+
+func decodeGzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func decodeDeflate(b []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func decodeBrotli(b []byte) ([]byte, error) {
+	return io.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+}
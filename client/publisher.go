@@ -0,0 +1,17 @@
+package client
+
+import "context"
+
+// Publisher publishes repeatedly to a fixed topic on behalf of a Client.
+type Publisher struct {
+	c     *Client
+	topic string
+}
+
+// Publish sends payload to the publisher's topic.
+func (p *Publisher) Publish(ctx context.Context, payload any) (Ack, error) {
+	return p.c.Publish(ctx, p.topic, payload)
+}
+
+// Topic returns the topic this Publisher sends to.
+func (p *Publisher) Topic() string { return p.topic }
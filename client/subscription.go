@@ -0,0 +1,46 @@
+package client
+
+import "sync"
+
+// Subscription is a live subscription to a topic. Messages arrives on
+// Messages(); delivery or protocol errors (including transient ones hit
+// during a reconnect) arrive on Errors() rather than being returned inline.
+type Subscription struct {
+	topic string
+	opts  SubscribeOptions
+
+	messages chan Message
+	errors   chan error
+
+	lastSeq  int64 // atomic; Seq of the most recently received event
+	closeMu  sync.Mutex
+	isClosed bool
+}
+
+// Messages returns the channel of delivered messages.
+func (s *Subscription) Messages() <-chan Message { return s.messages }
+
+// Errors returns the channel of subscription-level errors.
+func (s *Subscription) Errors() <-chan error { return s.errors }
+
+// Topic returns the subscribed topic name.
+func (s *Subscription) Topic() string { return s.topic }
+
+func (s *Subscription) pushErr(err error) {
+	select {
+	case s.errors <- err:
+	default:
+		// errors channel full: drop rather than block delivery.
+	}
+}
+
+func (s *Subscription) close() {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	if s.isClosed {
+		return
+	}
+	s.isClosed = true
+	close(s.messages)
+	close(s.errors)
+}
@@ -0,0 +1,45 @@
+package client
+
+import "time"
+
+// wire mirrors the JSON protocol spoken over /ws. It is kept in sync with
+// the server's ClientToServer/ServerToClient/Message types by hand since the
+// server is package main and cannot be imported.
+
+type wireMessage struct {
+	ID      string      `json:"id"`
+	Payload interface{} `json:"payload"`
+	Seq     int64       `json:"seq,omitempty"`
+	Ts      time.Time   `json:"ts,omitempty"`
+}
+
+type clientToServer struct {
+	Type         string       `json:"type"`
+	Topic        string       `json:"topic,omitempty"`
+	Message      *wireMessage `json:"message,omitempty"`
+	ClientID     string       `json:"client_id,omitempty"`
+	LastN        int          `json:"last_n,omitempty"`
+	FromSeq      int64        `json:"from_seq,omitempty"`
+	DeliveryMode string       `json:"delivery_mode,omitempty"`
+	Group        string       `json:"group,omitempty"`
+	Compression  string       `json:"compression,omitempty"`
+	Seq          int64        `json:"seq,omitempty"`
+	RequestID    string       `json:"request_id,omitempty"`
+}
+
+type errObj struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type serverToClient struct {
+	Type      string       `json:"type"`
+	RequestID string       `json:"request_id,omitempty"`
+	Topic     string       `json:"topic,omitempty"`
+	Message   *wireMessage `json:"message,omitempty"`
+	Encoding  string       `json:"encoding,omitempty"`
+	Error     *errObj      `json:"error,omitempty"`
+	TS        time.Time    `json:"ts,omitempty"`
+	Status    string       `json:"status,omitempty"`
+	Msg       string       `json:"msg,omitempty"`
+}
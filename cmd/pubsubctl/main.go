@@ -0,0 +1,97 @@
+// Command pubsubctl is a small CLI around the client package: it publishes
+// lines read from stdin to a topic, or subscribes to a topic and prints
+// messages as they arrive.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/CapTen101/pub-sub-go/client"
+)
+
+func main() {
+	var (
+		url    = flag.String("url", "ws://localhost:8080/ws", "server websocket URL")
+		apiKey = flag.String("api-key", os.Getenv("API_KEY"), "X-API-Key for authenticated servers")
+		topic  = flag.String("topic", "", "topic to publish to or subscribe on")
+		lastN  = flag.Int("last-n", 0, "replay the last N messages on subscribe")
+		group  = flag.String("group", "", "consumer group name for subscribe")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -topic NAME sub|pub\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *topic == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(ctx, client.Options{URL: *url, APIKey: *apiKey})
+	defer c.Close()
+
+	switch flag.Arg(0) {
+	case "sub":
+		runSub(ctx, c, *topic, *lastN, *group)
+	case "pub":
+		runPub(ctx, c, *topic)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func runSub(ctx context.Context, c *client.Client, topic string, lastN int, group string) {
+	sub, err := c.Subscribe(topic, client.SubscribeOptions{LastN: lastN, Group: group})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "subscribe:", err)
+		os.Exit(1)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-sub.Messages():
+			if !ok {
+				return
+			}
+			b, _ := json.Marshal(m.Payload)
+			fmt.Printf("[%s] seq=%d %s\n", topic, m.Seq, b)
+		case err, ok := <-sub.Errors():
+			if !ok {
+				return
+			}
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+}
+
+func runPub(ctx context.Context, c *client.Client, topic string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var payload any = line
+		if err := json.Unmarshal([]byte(line), &payload); err != nil {
+			payload = line // not JSON: publish as a raw string
+		}
+		if _, err := c.Publish(ctx, topic, payload); err != nil {
+			fmt.Fprintln(os.Stderr, "publish:", err)
+			continue
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "stdin:", err)
+		os.Exit(1)
+	}
+}
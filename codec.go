@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Codec compresses and decompresses message payloads for the wire.
+type Codec interface {
+	Name() string
+	Encode([]byte) ([]byte, error)
+	Decode([]byte) ([]byte, error)
+}
+
+// compressionThreshold: payloads smaller than this aren't worth the CPU cost
+// of compression, so they're sent uncompressed regardless of negotiation.
+// Overridable via COMPRESSION_THRESHOLD_BYTES, matching the
+// SUBSCRIBER_QUEUE_SIZE/ACK_VISIBILITY_TIMEOUT_SECONDS/TOPIC_DEFAULT_TTL
+// env-override pattern used elsewhere in this package.
+var compressionThreshold = func() int {
+	if v := os.Getenv("COMPRESSION_THRESHOLD_BYTES"); v != "" {
+		if n, _ := strconv.Atoi(v); n > 0 {
+			return n
+		}
+	}
+	return 512
+}()
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCodec) Decode(b []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type brotliCodec struct{}
+
+func (brotliCodec) Name() string { return "br" }
+
+func (brotliCodec) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (brotliCodec) Decode(b []byte) ([]byte, error) {
+	return io.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+}
+
+var codecsByName = map[string]Codec{
+	"gzip":    gzipCodec{},
+	"deflate": deflateCodec{},
+	"br":      brotliCodec{},
+}
+
+// negotiatedSubprotocols lists the compression codecs offered during the
+// WebSocket handshake, in preference order.
+var negotiatedSubprotocols = []string{"br", "gzip", "deflate"}
+
+func codecByName(name string) Codec {
+	return codecsByName[name]
+}
+
+type codecStats struct {
+	bytesIn  int64 // raw bytes before compression
+	bytesOut int64 // bytes actually put on the wire
+}
+
+var (
+	codecStatsMu sync.Mutex
+	codecStatsBy = map[string]*codecStats{}
+)
+
+func recordCodecStats(name string, rawLen, wireLen int) {
+	codecStatsMu.Lock()
+	defer codecStatsMu.Unlock()
+	s, ok := codecStatsBy[name]
+	if !ok {
+		s = &codecStats{}
+		codecStatsBy[name] = s
+	}
+	s.bytesIn += int64(rawLen)
+	s.bytesOut += int64(wireLen)
+}
+
+func codecStatsSnapshot() map[string]any {
+	codecStatsMu.Lock()
+	defer codecStatsMu.Unlock()
+	out := make(map[string]any, len(codecStatsBy))
+	for name, s := range codecStatsBy {
+		out[name] = map[string]any{"bytes_in": s.bytesIn, "bytes_out": s.bytesOut}
+	}
+	return out
+}
+
+// encodePayload compresses raw (a JSON-marshaled payload) with codec if it's
+// worth compressing, returning the bytes to put on the wire and the
+// encoding name to report to the client ("" means sent as-is).
+func encodePayload(codec Codec, raw []byte) ([]byte, string, error) {
+	if codec == nil || len(raw) < compressionThreshold {
+		return raw, "", nil
+	}
+	out, err := codec.Encode(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("codec %s: %w", codec.Name(), err)
+	}
+	recordCodecStats(codec.Name(), len(raw), len(out))
+	return out, codec.Name(), nil
+}
+
+// encodeForSubscriber compresses m.Payload for sub's negotiated codec, if
+// any, returning the message to send (with Payload replaced by a
+// base64-encoded compressed blob) and the encoding name to report in
+// ServerToClient.Encoding. If sub has no codec, or the payload is too small
+// to bother compressing, m is returned unchanged with an empty encoding.
+func encodeForSubscriber(sub *Subscriber, m Message) (Message, string) {
+	if sub.codec == nil {
+		return m, ""
+	}
+	raw, err := json.Marshal(m.Payload)
+	if err != nil {
+		return m, ""
+	}
+	out, name, err := encodePayload(sub.codec, raw)
+	if err != nil {
+		return m, ""
+	}
+	if name == "" {
+		return m, ""
+	}
+	m.Payload = base64.StdEncoding.EncodeToString(out)
+	return m, name
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ackVisibilityTimeout is how long an at_least_once message may sit unacked
+// before it is redelivered, matching the SUBSCRIBER_QUEUE_SIZE env-override
+// pattern used elsewhere in this package.
+var ackVisibilityTimeout = func() time.Duration {
+	if v := os.Getenv("ACK_VISIBILITY_TIMEOUT_SECONDS"); v != "" {
+		if n, _ := strconv.Atoi(v); n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 30 * time.Second
+}()
+
+const redeliveryScanInterval = 5 * time.Second
+
+// trackPending records m as awaiting acknowledgement, due for redelivery
+// after ackVisibilityTimeout unless acked or nacked first.
+func (s *Subscriber) trackPending(m Message) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[int64]Message)
+		s.ackDeadline = make(map[int64]time.Time)
+	}
+	s.pending[m.Seq] = m
+	s.ackDeadline[m.Seq] = time.Now().Add(ackVisibilityTimeout)
+}
+
+// ack clears a pending message. It reports whether seq was actually pending.
+func (s *Subscriber) ack(seq int64) bool {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if _, ok := s.pending[seq]; !ok {
+		return false
+	}
+	delete(s.pending, seq)
+	delete(s.ackDeadline, seq)
+	return true
+}
+
+// nack clears a pending message and redelivers it immediately. t must be
+// the topic s is subscribed to.
+func (s *Subscriber) nack(t *Topic, seq int64) {
+	s.pendingMu.Lock()
+	m, ok := s.pending[seq]
+	if ok {
+		delete(s.pending, seq)
+		delete(s.ackDeadline, seq)
+	}
+	s.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+	s.redeliver(t, m)
+}
+
+// redeliver re-queues m onto the subscriber's send channel and, for
+// at_least_once subscribers, tracks it as pending again. t must be the topic
+// s is subscribed to; redeliver re-confirms s is still registered there
+// under t.mu immediately before sending, since s may have disconnected (and
+// had s.send closed) between being selected for redelivery and this call.
+func (s *Subscriber) redeliver(t *Topic, m Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.subscribers[s.id]; !ok || cur != s {
+		return // disconnected (or replaced) since being selected for redelivery
+	}
+	select {
+	case s.send <- m:
+		if s.mode == AtLeastOnce {
+			s.trackPending(m)
+		}
+	default:
+		log.Printf("redelivery dropped for subscriber %s: queue full", s.id)
+	}
+}
+
+// expiredPending returns pending messages whose visibility timeout has
+// elapsed and removes them from the pending set (the caller is responsible
+// for redelivering them).
+func (s *Subscriber) expiredPending(now time.Time) []Message {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	var out []Message
+	for seq, deadline := range s.ackDeadline {
+		if now.After(deadline) {
+			out = append(out, s.pending[seq])
+			delete(s.pending, seq)
+			delete(s.ackDeadline, seq)
+		}
+	}
+	return out
+}
+
+// runRedeliveryLoop periodically scans every at_least_once subscriber across
+// all topics and redelivers messages that timed out waiting for an ack.
+func (tm *TopicsManager) runRedeliveryLoop() {
+	t := time.NewTicker(redeliveryScanInterval)
+	defer t.Stop()
+	for range t.C {
+		now := time.Now()
+		tm.mu.RLock()
+		topics := make([]*Topic, 0, len(tm.topics))
+		for _, topic := range tm.topics {
+			topics = append(topics, topic)
+		}
+		tm.mu.RUnlock()
+
+		for _, topic := range topics {
+			topic.mu.RLock()
+			subs := make([]*Subscriber, 0, len(topic.subscribers))
+			for _, s := range topic.subscribers {
+				if s.mode == AtLeastOnce {
+					subs = append(subs, s)
+				}
+			}
+			topic.mu.RUnlock()
+
+			for _, s := range subs {
+				for _, m := range s.expiredPending(now) {
+					s.redeliver(topic, m)
+				}
+			}
+		}
+	}
+}
+
+// deliverToGroup delivers m to exactly one healthy member of group, trying
+// other members in round-robin order if the chosen one's queue is full
+// instead of disconnecting anyone. It reports whether any member accepted
+// the message. t.mu must be held by the caller for writing, since this
+// updates t.groupCursor.
+func deliverToGroup(t *Topic, group string, members []*Subscriber, m Message) bool {
+	if len(members) == 0 {
+		return false
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].id < members[j].id })
+
+	start := t.groupCursor[group] % len(members)
+	for i := 0; i < len(members); i++ {
+		idx := (start + i) % len(members)
+		sub := members[idx]
+		select {
+		case sub.send <- m:
+			if sub.mode == AtLeastOnce {
+				sub.trackPending(m)
+			}
+			t.groupCursor[group] = (idx + 1) % len(members)
+			return true
+		default:
+			continue // this member's queue is full; try the next one
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestRedeliverDoesNotPanicOnConcurrentClose exercises the invariant the
+// chunk0-3 fix-up series (1a3695b, 2ef2b85) established: redeliver must
+// re-verify a subscriber is still registered under topic.mu immediately
+// before sending, since a channel closed by a concurrent Close stays
+// closed forever -- a stale reference picked up just before disconnect
+// would otherwise panic on send.
+func TestRedeliverDoesNotPanicOnConcurrentClose(t *testing.T) {
+	topicName := "redeliver-race-" + randomID()
+	if err := globalTopics.CreateTopic(topicName, TopicOptions{}); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	defer func() { _ = globalTopics.DeleteTopic(topicName) }()
+	topic, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		t.Fatalf("GetTopic: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		sub := &Subscriber{
+			id:     "sub-" + randomID(),
+			topic:  topicName,
+			send:   make(chan Message, 4),
+			conn:   fakeConn{},
+			closed: make(chan struct{}),
+			mode:   AtLeastOnce,
+		}
+		topic.mu.Lock()
+		topic.subscribers[sub.id] = sub
+		topic.mu.Unlock()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			sub.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			sub.redeliver(topic, Message{Seq: int64(i) + 1})
+		}()
+		wg.Wait()
+	}
+}
+
+// TestDeliverToGroupSkipsFullMembers verifies deliverToGroup's round-robin
+// fallback: when the next member in line is backed up, it tries the others
+// instead of dropping the message.
+func TestDeliverToGroupSkipsFullMembers(t *testing.T) {
+	topicName := "group-" + randomID()
+	if err := globalTopics.CreateTopic(topicName, TopicOptions{}); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	defer func() { _ = globalTopics.DeleteTopic(topicName) }()
+	topic, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		t.Fatalf("GetTopic: %v", err)
+	}
+
+	full := &Subscriber{id: "a", send: make(chan Message, 1), conn: fakeConn{}, closed: make(chan struct{}), group: "g"}
+	full.send <- Message{Seq: 0} // fill its queue so it can't accept another
+	ready := &Subscriber{id: "b", send: make(chan Message, 1), conn: fakeConn{}, closed: make(chan struct{}), group: "g"}
+	members := []*Subscriber{full, ready}
+
+	m := Message{Seq: 1}
+	if !deliverToGroup(topic, "g", members, m) {
+		t.Fatal("expected deliverToGroup to find the non-full member")
+	}
+	select {
+	case got := <-ready.send:
+		if got.Seq != m.Seq {
+			t.Fatalf("expected ready to receive seq=%d, got seq=%d", m.Seq, got.Seq)
+		}
+	default:
+		t.Fatal("expected the non-full member to receive the message")
+	}
+}
+
+// TestAckClearsPendingWithoutRedelivery verifies ack removes a message from
+// the pending set so it's not later redelivered, while nack both removes it
+// and redelivers it immediately.
+func TestAckClearsPendingWithoutRedelivery(t *testing.T) {
+	topicName := "ack-" + randomID()
+	if err := globalTopics.CreateTopic(topicName, TopicOptions{}); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	defer func() { _ = globalTopics.DeleteTopic(topicName) }()
+	topic, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		t.Fatalf("GetTopic: %v", err)
+	}
+
+	sub := &Subscriber{id: "sub", topic: topicName, send: make(chan Message, 2), conn: fakeConn{}, closed: make(chan struct{}), mode: AtLeastOnce}
+	topic.mu.Lock()
+	topic.subscribers[sub.id] = sub
+	topic.mu.Unlock()
+
+	m := Message{Seq: 1}
+	sub.trackPending(m)
+
+	if !sub.ack(m.Seq) {
+		t.Fatal("expected ack of a pending message to report true")
+	}
+	if sub.ack(m.Seq) {
+		t.Fatal("expected ack of an already-acked message to report false")
+	}
+	select {
+	case got := <-sub.send:
+		t.Fatalf("ack must not redeliver; got unexpected message seq=%d", got.Seq)
+	default:
+	}
+
+	sub.trackPending(m)
+	sub.nack(topic, m.Seq)
+	select {
+	case got := <-sub.send:
+		if got.Seq != m.Seq {
+			t.Fatalf("expected nack to redeliver seq=%d, got seq=%d", m.Seq, got.Seq)
+		}
+	default:
+		t.Fatal("expected nack to redeliver the message")
+	}
+}
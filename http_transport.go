@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// httpConnKind selects the wire framing used by an HTTP streaming subscriber.
+type httpConnKind int
+
+const (
+	httpConnSSE httpConnKind = iota
+	httpConnJSON
+	httpConnRaw
+)
+
+// httpConn adapts an http.ResponseWriter into a WSConn so that SSE, NDJSON
+// and raw-byte subscribers share the same fan-out and backpressure path as
+// WebSocket subscribers.
+type httpConn struct {
+	kind    httpConnKind
+	w       http.ResponseWriter
+	flusher http.Flusher
+	done    chan struct{}
+}
+
+func newHTTPConn(w http.ResponseWriter, kind httpConnKind) (*httpConn, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming unsupported by response writer")
+	}
+	return &httpConn{kind: kind, w: w, flusher: flusher, done: make(chan struct{})}, nil
+}
+
+// Read blocks until the connection is closed; HTTP streaming subscribers
+// are write-only, so there is nothing to read from the client.
+func (h *httpConn) Read(ctx context.Context) (ClientToServer, error) {
+	select {
+	case <-h.done:
+		return ClientToServer{}, io.EOF
+	case <-ctx.Done():
+		return ClientToServer{}, ctx.Err()
+	}
+}
+
+func (h *httpConn) Write(_ context.Context, msg ServerToClient) error {
+	var err error
+	switch h.kind {
+	case httpConnSSE:
+		if msg.Type != "event" {
+			return nil // keep-alives/pings are handled separately over SSE
+		}
+		var b []byte
+		b, err = json.Marshal(msg.Message)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(h.w, "data: %s\n\n", b)
+	case httpConnJSON:
+		if msg.Type != "event" {
+			return nil
+		}
+		var b []byte
+		b, err = json.Marshal(msg.Message)
+		if err != nil {
+			return err
+		}
+		_, err = h.w.Write(append(b, '\n'))
+	case httpConnRaw:
+		if msg.Type != "event" || msg.Message == nil {
+			return nil
+		}
+		_, err = h.w.Write(payloadBytes(msg.Message.Payload))
+	}
+	if err != nil {
+		return err
+	}
+	h.flusher.Flush()
+	return nil
+}
+
+func (h *httpConn) Close(websocket.StatusCode, string) error {
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+	return nil
+}
+
+func (h *httpConn) SetReadLimit(int64) {}
+
+// keepAlive writes a transport-appropriate keep-alive frame directly,
+// bypassing the Subscriber queue.
+func (h *httpConn) keepAlive() {
+	switch h.kind {
+	case httpConnSSE:
+		_, _ = io.WriteString(h.w, ": keep-alive\n\n")
+	default:
+		return
+	}
+	h.flusher.Flush()
+}
+
+func payloadBytes(payload any) []byte {
+	switch v := payload.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return b
+	}
+}
+
+func publishHandler(w http.ResponseWriter, r *http.Request, topic string) {
+	var payload any
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "body must be valid JSON")
+		return
+	}
+	if err := publishToTopic(topic, Message{Payload: payload}); err != nil {
+		if err == ErrTopicNotFound {
+			writeError(w, http.StatusNotFound, "TOPIC_NOT_FOUND", "topic not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "published", "topic": topic})
+}
+
+// messagesHandler is a pull-style REST alternative to the streaming
+// transports: GET /topics/{name}/messages?from_seq=&limit=.
+func messagesHandler(w http.ResponseWriter, r *http.Request, topicName string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	t, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "TOPIC_NOT_FOUND", "topic not found")
+		return
+	}
+	fromSeq, _ := strconv.ParseInt(r.URL.Query().Get("from_seq"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	messages, err := t.history.From(fromSeq, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"topic":       topicName,
+		"messages":    messages,
+		"current_seq": t.history.CurrentSeq(),
+	})
+}
+
+func sseHandler(w http.ResponseWriter, r *http.Request, topic string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	streamTopic(w, r, topic, httpConnSSE)
+}
+
+func jsonStreamHandler(w http.ResponseWriter, r *http.Request, topic string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	streamTopic(w, r, topic, httpConnJSON)
+}
+
+func rawStreamHandler(w http.ResponseWriter, r *http.Request, topic string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	streamTopic(w, r, topic, httpConnRaw)
+}
+
+// streamTopic registers an HTTP subscriber for topic and blocks until the
+// client disconnects, using the same Subscriber/backpressure path as
+// WebSocket subscribers.
+func streamTopic(w http.ResponseWriter, r *http.Request, topicName string, kind httpConnKind) {
+	t, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "TOPIC_NOT_FOUND", "topic not found")
+		return
+	}
+
+	conn, err := newHTTPConn(w, kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		clientID = randomID()
+	}
+	sub := &Subscriber{
+		id:     clientID,
+		topic:  t.name,
+		send:   make(chan Message, subscriberQueueSize),
+		conn:   conn,
+		closed: make(chan struct{}),
+	}
+
+	// The cursor must be snapshotted inside the same topic.mu critical
+	// section as registration, not after: publishToTopic holds this same
+	// lock across its history.Append + fan-out, so reading the cursor while
+	// still holding the lock guarantees a message is either fully
+	// appended-and-fanned-out before we register (and thus belongs to the
+	// replay window) or not yet appended at all (and thus arrives only via
+	// live fan-out) -- never both. See ws.go's "subscribe" case, which this
+	// mirrors.
+	t.mu.Lock()
+	if old, ok := t.subscribers[sub.id]; ok {
+		old.closeLocked(t) // t.mu is already held here, unlike the Close elsewhere in this func
+	}
+	t.subscribers[sub.id] = sub
+	t.last = time.Now()
+	cursor := t.history.CurrentSeq()
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		if cur, ok := t.subscribers[sub.id]; ok && cur == sub {
+			delete(t.subscribers, sub.id)
+		}
+		t.mu.Unlock()
+		sub.Close()
+	}()
+
+	if n, _ := strconv.Atoi(r.URL.Query().Get("last_n")); n > 0 {
+		for _, m := range t.history.LastN(n) {
+			if m.Seq > cursor {
+				continue // will be (or already was) delivered via live fan-out
+			}
+			select {
+			case sub.send <- m:
+			default:
+				sub.CloseWithError("SLOW_CONSUMER", "replay overflow")
+				return
+			}
+		}
+	}
+
+	go subscriberWriteLoop(ctx, t.name, sub)
+
+	keepAlive := time.NewTicker(heartbeatInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.closed:
+			return
+		case <-keepAlive.C:
+			conn.keepAlive()
+		}
+	}
+}
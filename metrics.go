@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics is a small in-process registry that renders itself in Prometheus
+// text exposition format. It exists so that TopicsManager, publishToTopic,
+// wsHandler, and Subscriber can record counters/gauges without pulling the
+// official client library into every file that needs to instrument
+// something; it replaces what would otherwise be a periodic stats-logging
+// goroutine with scrape-friendly output on /metrics.
+var metrics = newMetricsRegistry()
+
+type counterKey struct {
+	name  string
+	topic string
+}
+
+type gaugeKey struct {
+	topic    string
+	clientID string
+}
+
+// publishLatencyBuckets are Prometheus-style cumulative upper bounds, in
+// seconds, for pubsub_publish_latency_seconds.
+var publishLatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type histogram struct {
+	buckets []float64
+	counts  []int64 // counts[i] = observations <= buckets[i]; counts[len(buckets)] = +Inf
+	sum     float64
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.buckets)]++
+}
+
+type metricsRegistry struct {
+	mu             sync.Mutex
+	counters       map[counterKey]int64
+	queueDepth     map[gaugeKey]int64
+	publishLatency *histogram
+	wsConnections  int64 // accessed via atomic
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		counters:       make(map[counterKey]int64),
+		queueDepth:     make(map[gaugeKey]int64),
+		publishLatency: newHistogram(publishLatencyBuckets),
+	}
+}
+
+func (m *metricsRegistry) incCounter(name, topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[counterKey{name, topic}]++
+}
+
+func (m *metricsRegistry) observePublishLatency(seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publishLatency.observe(seconds)
+}
+
+func (m *metricsRegistry) connectionOpened() { atomic.AddInt64(&m.wsConnections, 1) }
+func (m *metricsRegistry) connectionClosed() { atomic.AddInt64(&m.wsConnections, -1) }
+
+// sampleQueueDepths runs for the lifetime of tm, refreshing
+// pubsub_subscriber_queue_depth for every live subscriber every few seconds.
+// Gauges are rebuilt from scratch each tick so a subscriber that disconnects
+// between ticks doesn't leave a stale series behind.
+func (m *metricsRegistry) sampleQueueDepths(tm *TopicsManager) {
+	t := time.NewTicker(5 * time.Second)
+	defer t.Stop()
+	for range t.C {
+		tm.mu.RLock()
+		topics := make([]*Topic, 0, len(tm.topics))
+		for _, topic := range tm.topics {
+			topics = append(topics, topic)
+		}
+		tm.mu.RUnlock()
+
+		fresh := make(map[gaugeKey]int64)
+		for _, topic := range topics {
+			topic.mu.RLock()
+			for id, sub := range topic.subscribers {
+				fresh[gaugeKey{topic.name, id}] = int64(len(sub.send))
+			}
+			topic.mu.RUnlock()
+		}
+
+		m.mu.Lock()
+		m.queueDepth = fresh
+		m.mu.Unlock()
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.writeTo(w)
+}
+
+func (m *metricsRegistry) writeTo(w io.Writer) {
+	m.mu.Lock()
+	byName := map[string]map[string]int64{}
+	for k, v := range m.counters {
+		if byName[k.name] == nil {
+			byName[k.name] = map[string]int64{}
+		}
+		byName[k.name][k.topic] = v
+	}
+	queueDepth := make(map[gaugeKey]int64, len(m.queueDepth))
+	for k, v := range m.queueDepth {
+		queueDepth[k] = v
+	}
+	publishLatency := histogram{
+		buckets: m.publishLatency.buckets,
+		counts:  append([]int64(nil), m.publishLatency.counts...),
+		sum:     m.publishLatency.sum,
+		count:   m.publishLatency.count,
+	}
+	wsConns := atomic.LoadInt64(&m.wsConnections)
+	m.mu.Unlock()
+
+	writeCounter(w, "pubsub_messages_published_total", "Total messages published per topic.", byName["messages_published"])
+	writeCounter(w, "pubsub_messages_delivered_total", "Total messages delivered to subscribers per topic.", byName["messages_delivered"])
+	writeCounter(w, "pubsub_slow_consumer_disconnects_total", "Total subscribers disconnected for being too slow, per topic.", byName["slow_consumer_disconnects"])
+
+	fmt.Fprintln(w, "# HELP pubsub_topic_subscribers Current subscriber count per topic.")
+	fmt.Fprintln(w, "# TYPE pubsub_topic_subscribers gauge")
+	for _, t := range globalTopics.ListTopics() {
+		fmt.Fprintf(w, "pubsub_topic_subscribers{topic=%q} %v\n", t["name"], t["subscribers"])
+	}
+
+	fmt.Fprintln(w, "# HELP pubsub_subscriber_queue_depth Messages currently queued for a subscriber.")
+	fmt.Fprintln(w, "# TYPE pubsub_subscriber_queue_depth gauge")
+	keys := make([]gaugeKey, 0, len(queueDepth))
+	for k := range queueDepth {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].topic != keys[j].topic {
+			return keys[i].topic < keys[j].topic
+		}
+		return keys[i].clientID < keys[j].clientID
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "pubsub_subscriber_queue_depth{topic=%q,client_id=%q} %d\n", k.topic, k.clientID, queueDepth[k])
+	}
+
+	writeHistogram(w, "pubsub_publish_latency_seconds", "Time spent fanning a published message out to subscribers.", &publishLatency)
+
+	fmt.Fprintln(w, "# HELP pubsub_websocket_connections Currently open WebSocket connections.")
+	fmt.Fprintln(w, "# TYPE pubsub_websocket_connections gauge")
+	fmt.Fprintf(w, "pubsub_websocket_connections %d\n", wsConns)
+}
+
+func writeCounter(w io.Writer, name, help string, byTopic map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	topics := make([]string, 0, len(byTopic))
+	for t := range byTopic {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		fmt.Fprintf(w, "%s{topic=%q} %d\n", name, t, byTopic[t])
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.counts[len(h.buckets)])
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'f', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
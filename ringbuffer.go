@@ -1,14 +1,19 @@
 package main
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
-// RingBuffer is a simple fixed-size ring buffer for Message.
+// RingBuffer is a fixed-size, in-memory TopicLog. It is the default history
+// implementation for topics that don't need durability across restarts.
 type RingBuffer struct {
 	mu   sync.RWMutex
 	data []Message
 	size int
 	next int
 	full bool
+	seq  int64
 }
 
 func NewRingBuffer(size int) *RingBuffer {
@@ -18,14 +23,22 @@ func NewRingBuffer(size int) *RingBuffer {
 	}
 }
 
-func (r *RingBuffer) Add(m Message) {
+// Append assigns the next sequence number and timestamp to m and stores it,
+// overwriting the oldest entry once the buffer is full.
+func (r *RingBuffer) Append(m Message) (Message, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.seq++
+	m.Seq = r.seq
+	if m.Ts.IsZero() {
+		m.Ts = time.Now().UTC()
+	}
 	r.data[r.next] = m
 	r.next = (r.next + 1) % r.size
 	if r.next == 0 {
 		r.full = true
 	}
+	return m, nil
 }
 
 func (r *RingBuffer) LastN(n int) []Message {
@@ -55,4 +68,59 @@ func (r *RingBuffer) LastN(n int) []Message {
 		out = append(out, r.data[idx])
 	}
 	return out
-}
\ No newline at end of file
+}
+
+// ordered returns the currently-held messages oldest first.
+func (r *RingBuffer) ordered() []Message {
+	if !r.full {
+		out := make([]Message, r.next)
+		copy(out, r.data[:r.next])
+		return out
+	}
+	out := make([]Message, r.size)
+	for i := 0; i < r.size; i++ {
+		out[i] = r.data[(r.next+i)%r.size]
+	}
+	return out
+}
+
+func (r *RingBuffer) From(fromSeq int64, limit int) ([]Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Message, 0)
+	for _, m := range r.ordered() {
+		if m.Seq >= fromSeq {
+			out = append(out, m)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *RingBuffer) FromTime(t time.Time, limit int) ([]Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Message, 0)
+	for _, m := range r.ordered() {
+		if !m.Ts.Before(t) {
+			out = append(out, m)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *RingBuffer) CurrentSeq() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.seq
+}
+
+func (r *RingBuffer) Close() error { return nil }
+
+// Purge is Close: a RingBuffer holds nothing on disk to delete.
+func (r *RingBuffer) Purge() error { return nil }
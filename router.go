@@ -15,8 +15,9 @@ func setupRouter() http.Handler {
 	// REST endpoints
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/stats", statsHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
 	mux.HandleFunc("/topics", topicsCollectionHandler) // POST /topics, GET /topics
-	mux.HandleFunc("/topics/", topicsItemHandler)      // DELETE /topics/{name}
+	mux.HandleFunc("/topics/", topicsItemHandler)      // POST/DELETE /topics/{name}, GET /topics/{name}/{sse,json,raw,messages}
 
 	// default
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -33,13 +34,17 @@ func topicsCollectionHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		var req struct {
-			Name string `json:"name"`
+			Name             string `json:"name"`
+			RetentionSeconds int64  `json:"retention_seconds,omitempty"`
+			RetentionBytes   int64  `json:"retention_bytes,omitempty"`
+			TTLSeconds       int64  `json:"ttl_seconds,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
 			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "name is required")
 			return
 		}
-		if err := globalTopics.CreateTopic(req.Name); err != nil {
+		opts := TopicOptions{RetentionSeconds: req.RetentionSeconds, RetentionBytes: req.RetentionBytes, TTLSeconds: req.TTLSeconds}
+		if err := globalTopics.CreateTopic(req.Name, opts); err != nil {
 			if err == ErrTopicExists {
 				writeError(w, http.StatusConflict, "CONFLICT", "topic already exists")
 				return
@@ -57,26 +62,46 @@ func topicsCollectionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func topicsItemHandler(w http.ResponseWriter, r *http.Request) {
-	// /topics/{name}
-	if r.Method != http.MethodDelete {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
+	// /topics/{name}[/sse|/json|/raw|/messages]
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/topics/"), "/")
 	if len(parts) == 0 || parts[0] == "" {
 		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "topic name required")
 		return
 	}
 	name := parts[0]
-	if err := globalTopics.DeleteTopic(name); err != nil {
-		if err == ErrTopicNotFound {
-			writeError(w, http.StatusNotFound, "TOPIC_NOT_FOUND", "topic not found")
-			return
+
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "sse":
+			sseHandler(w, r, name)
+		case "json":
+			jsonStreamHandler(w, r, name)
+		case "raw":
+			rawStreamHandler(w, r, name)
+		case "messages":
+			messagesHandler(w, r, name)
+		default:
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown topic sub-resource")
 		}
-		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"status": "deleted", "topic": name})
+
+	switch r.Method {
+	case http.MethodPost:
+		publishHandler(w, r, name)
+	case http.MethodDelete:
+		if err := globalTopics.DeleteTopic(name); err != nil {
+			if err == ErrTopicNotFound {
+				writeError(w, http.StatusNotFound, "TOPIC_NOT_FOUND", "topic not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted", "topic": name})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -90,7 +115,10 @@ func statsHandler(w http.ResponseWriter, r *http.Request) {
 func requireAPIKey(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-        // Allow unauthenticated health & root requests (needed for Render)
+        // Allow unauthenticated health & root requests only (needed for
+        // Render's health checks). /metrics exposes per-topic names and
+        // counts, so it's gated behind API_KEY like the rest of the API;
+        // scrape configs need to set the same X-API-Key header.
         if r.URL.Path == "/health" || r.URL.Path == "/" {
             next.ServeHTTP(w, r)
             return
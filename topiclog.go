@@ -0,0 +1,30 @@
+package main
+
+import "time"
+
+// TopicLog is the per-topic message history used for replay. Implementations
+// assign each appended message a monotonically increasing sequence number
+// and support replay by count, sequence, or time so subscribers can catch up
+// without re-reading the whole history.
+type TopicLog interface {
+	// Append assigns Seq (and Ts, if unset) to m, stores it, and returns the
+	// stored copy.
+	Append(m Message) (Message, error)
+	// LastN returns up to the n most recently appended messages, oldest first.
+	LastN(n int) []Message
+	// From returns up to limit messages with Seq >= fromSeq, oldest first.
+	// limit <= 0 means no limit.
+	From(fromSeq int64, limit int) ([]Message, error)
+	// FromTime returns up to limit messages with Ts >= t, oldest first.
+	// limit <= 0 means no limit.
+	FromTime(t time.Time, limit int) ([]Message, error)
+	// CurrentSeq returns the sequence number of the most recently appended
+	// message, or 0 if the log is empty.
+	CurrentSeq() int64
+	// Close releases any resources held by the log.
+	Close() error
+	// Purge closes the log and permanently deletes any on-disk history, so a
+	// topic recreated with the same name afterward starts with no history
+	// instead of recovering whatever was there before.
+	Purge() error
+}
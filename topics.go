@@ -2,6 +2,10 @@ package main
 
 import (
 	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -14,47 +18,136 @@ var (
 type TopicsManager struct {
 	mu     sync.RWMutex
 	topics map[string]*Topic
-	start  time.Time
+	// expired tracks topics reaped for being idle past their TTL, so a
+	// subscriber that arrives just after reaping can be told why its topic
+	// disappeared instead of getting a bare TOPIC_NOT_FOUND. Entries older
+	// than expiredRetention are pruned as new topics are reaped.
+	expired map[string]time.Time
+	start   time.Time
 }
 
 type Topic struct {
 	name        string
 	mu          sync.RWMutex
 	subscribers map[string]*Subscriber
-	history     *RingBuffer
+	history     TopicLog
 	msgCount    int64
+	groupCursor map[string]int // group name -> round-robin offset into its members
+	ttl         time.Duration  // 0 disables idle reaping for this topic
+	last        time.Time      // time of the last publish or subscribe, for idle reaping
 }
 
+// TopicOptions configures durability, retention, and idle TTL for a topic's
+// history at creation time.
+type TopicOptions struct {
+	// RetentionSeconds and RetentionBytes only apply when the server is
+	// running with TOPIC_DATA_DIR set, i.e. when history is WAL-backed.
+	RetentionSeconds int64
+	RetentionBytes   int64
+	// TTLSeconds is how long the topic may go without a publish or subscribe
+	// before it is reaped, which happens only if it then has no subscribers.
+	// 0 means fall back to the server default, TOPIC_DEFAULT_TTL.
+	TTLSeconds int64
+}
+
+// defaultTopicTTL is the server-wide idle TTL applied to topics that don't
+// set their own ttl_seconds. 0 (the default, and TOPIC_DEFAULT_TTL unset or
+// non-positive) disables idle reaping entirely.
+var defaultTopicTTL = func() time.Duration {
+	if v := os.Getenv("TOPIC_DEFAULT_TTL"); v != "" {
+		if n, _ := strconv.Atoi(v); n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
+}()
+
+func resolveTTL(ttlSeconds int64) time.Duration {
+	if ttlSeconds > 0 {
+		return time.Duration(ttlSeconds) * time.Second
+	}
+	return defaultTopicTTL
+}
+
+const (
+	idleReapInterval = 30 * time.Second
+	expiredRetention = time.Minute
+)
+
+// DeliveryMode selects how a subscriber expects messages to be acknowledged.
+type DeliveryMode string
+
+const (
+	AtMostOnce  DeliveryMode = "at_most_once"  // fire-and-forget (default, original behavior)
+	AtLeastOnce DeliveryMode = "at_least_once" // requires ack; unacked messages are redelivered
+)
+
 type Subscriber struct {
 	id     string
+	topic  string       // name of the topic this subscriber is attached to, for metrics labels
 	send   chan Message // bounded channel for backpressure
 	conn   WSConn       // abstracted websocket conn
 	closed chan struct{}
+
+	mode  DeliveryMode
+	group string // consumer group name; "" means broadcast to every subscriber
+	codec Codec  // negotiated payload compression, if any
+
+	pendingMu   sync.Mutex
+	pending     map[int64]Message   // seq -> message awaiting ack, at_least_once only
+	ackDeadline map[int64]time.Time // seq -> redelivery deadline
 }
 
 func NewTopicsManager() *TopicsManager {
-	return &TopicsManager{
-		topics: make(map[string]*Topic),
-		start:  time.Now(),
+	tm := &TopicsManager{
+		topics:  make(map[string]*Topic),
+		expired: make(map[string]time.Time),
+		start:   time.Now(),
 	}
+	go tm.runRedeliveryLoop()
+	go metrics.sampleQueueDepths(tm)
+	go tm.runIdleReapLoop()
+	return tm
 }
 
 var globalTopics = NewTopicsManager()
 
-func (tm *TopicsManager) CreateTopic(name string) error {
+func (tm *TopicsManager) CreateTopic(name string, opts TopicOptions) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 	if _, ok := tm.topics[name]; ok {
 		return ErrTopicExists
 	}
+	log, err := newTopicLog(name, opts)
+	if err != nil {
+		return err
+	}
 	tm.topics[name] = &Topic{
 		name:        name,
 		subscribers: make(map[string]*Subscriber),
-		history:     NewRingBuffer(100),
+		history:     log,
+		groupCursor: make(map[string]int),
+		ttl:         resolveTTL(opts.TTLSeconds),
+		last:        time.Now(),
 	}
 	return nil
 }
 
+// newTopicLog builds the TopicLog for a new topic: a durable WAL under
+// TOPIC_DATA_DIR/<name> if that env var is set, or a bounded in-memory
+// RingBuffer otherwise.
+func newTopicLog(name string, opts TopicOptions) (TopicLog, error) {
+	dataDir := getEnv("TOPIC_DATA_DIR", "")
+	if dataDir == "" {
+		return NewRingBuffer(100), nil
+	}
+	return NewWAL(WALOptions{
+		Dir:            filepath.Join(dataDir, name),
+		RetentionAge:   time.Duration(opts.RetentionSeconds) * time.Second,
+		RetentionBytes: opts.RetentionBytes,
+	})
+}
+
 func (tm *TopicsManager) GetTopic(name string) (*Topic, error) {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
@@ -72,27 +165,110 @@ func (tm *TopicsManager) DeleteTopic(name string) error {
 	if !ok {
 		return ErrTopicNotFound
 	}
-	// disconnect all subscribers
+	// disconnect all subscribers; t.mu is held here, so closeLocked rather
+	// than Close (which would try to re-acquire it).
 	t.mu.Lock()
 	for _, sub := range t.subscribers {
-		sub.Close()
+		sub.closeLocked(t)
 	}
 	t.mu.Unlock()
+	_ = t.history.Close()
 	delete(tm.topics, name)
 	// broadcast info to others is handled on ws loop when reading this error response
 	return nil
 }
 
+// runIdleReapLoop wakes every idleReapInterval and deletes topics that have
+// sat past their TTL with no subscribers. There's nothing to disconnect in
+// that case, unlike DeleteTopic, since a zero-subscriber precondition is
+// exactly what makes a topic eligible.
+func (tm *TopicsManager) runIdleReapLoop() {
+	t := time.NewTicker(idleReapInterval)
+	defer t.Stop()
+	for range t.C {
+		tm.reapIdleTopics()
+	}
+}
+
+// idleAndExpired reports whether a topic is eligible for reaping: it has a
+// TTL, is past it, and has no subscribers. The caller must hold t.mu (for at
+// least reading).
+func (t *Topic) idleAndExpired() bool {
+	return t.ttl > 0 && time.Since(t.last) > t.ttl && len(t.subscribers) == 0
+}
+
+func (tm *TopicsManager) reapIdleTopics() {
+	tm.mu.RLock()
+	var candidates []*Topic
+	for _, t := range tm.topics {
+		t.mu.RLock()
+		expired := t.idleAndExpired()
+		t.mu.RUnlock()
+		if expired {
+			candidates = append(candidates, t)
+		}
+	}
+	tm.mu.RUnlock()
+	if len(candidates) == 0 {
+		return
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for name, at := range tm.expired {
+		if time.Since(at) > expiredRetention {
+			delete(tm.expired, name)
+		}
+	}
+	for _, t := range candidates {
+		cur, ok := tm.topics[t.name]
+		if !ok || cur != t {
+			continue // replaced or already removed since the scan above
+		}
+		t.mu.RLock()
+		stillExpired := t.idleAndExpired()
+		t.mu.RUnlock()
+		if !stillExpired {
+			continue
+		}
+		// Purge, not Close: a reaped topic is gone for good, so its on-disk
+		// WAL segments (if any) should go with it rather than being picked
+		// back up if a topic of the same name is recreated later.
+		_ = t.history.Purge()
+		delete(tm.topics, t.name)
+		tm.expired[t.name] = time.Now()
+		log.Printf("reaped idle topic %s (ttl=%s)", t.name, t.ttl)
+	}
+}
+
+// wasRecentlyExpired reports whether name was reaped for being idle within
+// the last expiredRetention, so a subscriber arriving just after can be told
+// why rather than getting a bare TOPIC_NOT_FOUND.
+func (tm *TopicsManager) wasRecentlyExpired(name string) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	at, ok := tm.expired[name]
+	return ok && time.Since(at) < expiredRetention
+}
+
 func (tm *TopicsManager) ListTopics() []map[string]any {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 	out := make([]map[string]any, 0, len(tm.topics))
 	for _, t := range tm.topics {
 		t.mu.RLock()
-		out = append(out, map[string]any{
+		entry := map[string]any{
 			"name":        t.name,
 			"subscribers": len(t.subscribers),
-		})
+		}
+		if t.ttl > 0 {
+			if remaining := t.ttl - time.Since(t.last); remaining > 0 {
+				entry["ttl_seconds_remaining"] = int64(remaining.Seconds())
+			} else {
+				entry["ttl_seconds_remaining"] = int64(0)
+			}
+		}
+		out = append(out, entry)
 		t.mu.RUnlock()
 	}
 	return out
@@ -115,7 +291,7 @@ func (tm *TopicsManager) Health() map[string]any {
 }
 
 func (tm *TopicsManager) Stats() map[string]any {
-	stats := map[string]any{"topics": map[string]any{}}
+	stats := map[string]any{"topics": map[string]any{}, "compression": codecStatsSnapshot()}
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 	topics := stats["topics"].(map[string]any)
@@ -134,11 +310,13 @@ func (tm *TopicsManager) CloseAll() {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 	for _, t := range tm.topics {
-		t.mu.RLock()
+		// closeLocked mutates t.subscribers, so this needs the write lock,
+		// not RLock.
+		t.mu.Lock()
 		for _, s := range t.subscribers {
-			s.Close()
+			s.closeLocked(t)
 		}
-		t.mu.RUnlock()
+		t.mu.Unlock()
 	}
 }
 
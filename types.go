@@ -3,23 +3,30 @@ package main
 import "time"
 
 type ClientToServer struct {
-	Type       string      `json:"type"`
-	Topic      string      `json:"topic,omitempty"`
-	Message    *Message    `json:"message,omitempty"`
-	ClientID   string      `json:"client_id,omitempty"`
-	LastN      int         `json:"last_n,omitempty"`
-	RequestID  string      `json:"request_id,omitempty"`
+	Type         string       `json:"type"`
+	Topic        string       `json:"topic,omitempty"`
+	Message      *Message     `json:"message,omitempty"`
+	ClientID     string       `json:"client_id,omitempty"`
+	LastN        int          `json:"last_n,omitempty"`
+	FromSeq      int64        `json:"from_seq,omitempty"`
+	FromTime     time.Time    `json:"from_time,omitempty"`
+	DeliveryMode DeliveryMode `json:"delivery_mode,omitempty"`
+	Group        string       `json:"group,omitempty"`
+	Seq          int64        `json:"seq,omitempty"`         // for ack/nack
+	Compression  string       `json:"compression,omitempty"` // "gzip", "deflate", or "br"
+	RequestID    string       `json:"request_id,omitempty"`
 }
 
 type ServerToClient struct {
-	Type      string      `json:"type"`
-	RequestID string      `json:"request_id,omitempty"`
-	Topic     string      `json:"topic,omitempty"`
-	Message   *Message    `json:"message,omitempty"`
-	Error     *ErrObj     `json:"error,omitempty"`
-	TS        time.Time   `json:"ts,omitempty"`
-	Status    string      `json:"status,omitempty"` // for ack
-	Msg       string      `json:"msg,omitempty"`    // for info
+	Type      string    `json:"type"`
+	RequestID string    `json:"request_id,omitempty"`
+	Topic     string    `json:"topic,omitempty"`
+	Message   *Message  `json:"message,omitempty"`
+	Error     *ErrObj   `json:"error,omitempty"`
+	TS        time.Time `json:"ts,omitempty"`
+	Status    string    `json:"status,omitempty"`   // for ack
+	Msg       string    `json:"msg,omitempty"`      // for info
+	Encoding  string    `json:"encoding,omitempty"` // set when Message.Payload is compressed+base64
 }
 
 type ErrObj struct {
@@ -30,4 +37,6 @@ type ErrObj struct {
 type Message struct {
 	ID      string      `json:"id"`
 	Payload interface{} `json:"payload"`
-}
\ No newline at end of file
+	Seq     int64       `json:"seq,omitempty"`
+	Ts      time.Time   `json:"ts,omitempty"`
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -39,6 +41,14 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// randomID returns a short random hex identifier, used when a caller does
+// not supply its own client ID.
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WALOptions configures a segmented, file-backed TopicLog.
+type WALOptions struct {
+	Dir             string
+	SegmentMaxBytes int64
+	RetentionAge    time.Duration // 0 disables age-based pruning
+	RetentionBytes  int64         // 0 disables size-based pruning
+}
+
+const walRecordHeaderSize = 4 + 4 // length prefix + crc32
+
+type walRecord struct {
+	Seq     int64           `json:"seq"`
+	Ts      time.Time       `json:"ts"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type walEntry struct {
+	Seq     int64
+	Ts      time.Time
+	Segment int
+	Offset  int64
+	Length  int32
+}
+
+// WAL is a TopicLog backed by a sequence of append-only segment files under
+// Dir, so topic history survives process restarts and can grow far beyond
+// what fits in memory. Records are length-prefixed and CRC-checked so a
+// torn write at the tail of a segment (e.g. after a crash) is detected and
+// skipped on recovery rather than corrupting the rest of the log.
+type WAL struct {
+	mu       sync.Mutex
+	opts     WALOptions
+	index    []walEntry
+	seq      int64
+	curFile  *os.File
+	curNum   int
+	curBytes int64
+}
+
+func NewWAL(opts WALOptions) (*WAL, error) {
+	if opts.SegmentMaxBytes <= 0 {
+		opts.SegmentMaxBytes = 8 << 20 // 8MB
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: create dir %s: %w", opts.Dir, err)
+	}
+	w := &WAL{opts: opts}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+	w.prune()
+	return w, nil
+}
+
+func (w *WAL) segmentPath(n int) string {
+	return filepath.Join(w.opts.Dir, fmt.Sprintf("%08d.seglog", n))
+}
+
+func (w *WAL) segmentNumbers() ([]int, error) {
+	entries, err := os.ReadDir(w.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var nums []int
+	for _, e := range entries {
+		var n int
+		if _, err := fmt.Sscanf(e.Name(), "%08d.seglog", &n); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+func (w *WAL) recover() error {
+	nums, err := w.segmentNumbers()
+	if err != nil {
+		return err
+	}
+	if len(nums) == 0 {
+		nums = []int{1}
+	}
+	for _, n := range nums {
+		if err := w.recoverSegment(n); err != nil {
+			return err
+		}
+	}
+	last := nums[len(nums)-1]
+	f, err := os.OpenFile(w.segmentPath(last), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: open segment %d: %w", last, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	// Cut off a torn tail so later appends follow the last good record
+	// instead of landing behind bytes that recovery stops at.
+	valid := int64(0)
+	if n := len(w.index); n > 0 && w.index[n-1].Segment == last {
+		e := w.index[n-1]
+		valid = e.Offset + int64(walRecordHeaderSize) + int64(e.Length)
+	}
+	if info.Size() > valid {
+		if err := f.Truncate(valid); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	w.curFile = f
+	w.curNum = last
+	w.curBytes = valid
+	return nil
+}
+
+// recoverSegment replays a segment's records into the in-memory index,
+// stopping at the first torn or corrupt record (the tail of the last
+// segment written before a crash).
+func (w *WAL) recoverSegment(n int) error {
+	f, err := os.Open(w.segmentPath(n))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		header := make([]byte, walRecordHeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		wantCRC := binary.BigEndian.Uint32(header[4:])
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(buf) != wantCRC {
+			break
+		}
+		var rec walRecord
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			break
+		}
+		w.index = append(w.index, walEntry{Seq: rec.Seq, Ts: rec.Ts, Segment: n, Offset: offset, Length: int32(length)})
+		if rec.Seq > w.seq {
+			w.seq = rec.Seq
+		}
+		offset += int64(walRecordHeaderSize) + int64(length)
+	}
+	return nil
+}
+
+func (w *WAL) Append(m Message) (Message, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	m.Seq = w.seq
+	if m.Ts.IsZero() {
+		m.Ts = time.Now().UTC()
+	}
+	payload, err := json.Marshal(m.Payload)
+	if err != nil {
+		return m, err
+	}
+	buf, err := json.Marshal(walRecord{Seq: m.Seq, Ts: m.Ts, ID: m.ID, Payload: payload})
+	if err != nil {
+		return m, err
+	}
+
+	if w.curBytes+int64(walRecordHeaderSize+len(buf)) > w.opts.SegmentMaxBytes {
+		if err := w.rotate(); err != nil {
+			return m, err
+		}
+	}
+
+	header := make([]byte, walRecordHeaderSize)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(buf)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(buf))
+	if _, err := w.curFile.Write(header); err != nil {
+		return m, err
+	}
+	if _, err := w.curFile.Write(buf); err != nil {
+		return m, err
+	}
+
+	w.index = append(w.index, walEntry{Seq: m.Seq, Ts: m.Ts, Segment: w.curNum, Offset: w.curBytes, Length: int32(len(buf))})
+	w.curBytes += int64(walRecordHeaderSize + len(buf))
+
+	w.pruneLocked()
+	return m, nil
+}
+
+func (w *WAL) rotate() error {
+	if err := w.curFile.Close(); err != nil {
+		return err
+	}
+	w.curNum++
+	w.curBytes = 0
+	f, err := os.OpenFile(w.segmentPath(w.curNum), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.curFile = f
+	return nil
+}
+
+func (w *WAL) readEntry(e walEntry) (Message, error) {
+	f, err := os.Open(w.segmentPath(e.Segment))
+	if err != nil {
+		return Message{}, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(e.Offset+int64(walRecordHeaderSize), io.SeekStart); err != nil {
+		return Message{}, err
+	}
+	buf := make([]byte, e.Length)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return Message{}, err
+	}
+	var rec walRecord
+	if err := json.Unmarshal(buf, &rec); err != nil {
+		return Message{}, err
+	}
+	var payload any
+	if err := json.Unmarshal(rec.Payload, &payload); err != nil {
+		return Message{}, err
+	}
+	return Message{ID: rec.ID, Payload: payload, Seq: rec.Seq, Ts: rec.Ts}, nil
+}
+
+func (w *WAL) LastN(n int) []Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n <= 0 || len(w.index) == 0 {
+		return nil
+	}
+	if n > len(w.index) {
+		n = len(w.index)
+	}
+	entries := w.index[len(w.index)-n:]
+	out := make([]Message, 0, len(entries))
+	for _, e := range entries {
+		if m, err := w.readEntry(e); err == nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (w *WAL) From(fromSeq int64, limit int) ([]Message, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	i := sort.Search(len(w.index), func(i int) bool { return w.index[i].Seq >= fromSeq })
+	return w.collectLocked(i, limit)
+}
+
+func (w *WAL) FromTime(t time.Time, limit int) ([]Message, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	i := sort.Search(len(w.index), func(i int) bool { return !w.index[i].Ts.Before(t) })
+	return w.collectLocked(i, limit)
+}
+
+func (w *WAL) collectLocked(start, limit int) ([]Message, error) {
+	if start >= len(w.index) {
+		return nil, nil
+	}
+	entries := w.index[start:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+	out := make([]Message, 0, len(entries))
+	for _, e := range entries {
+		m, err := w.readEntry(e)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (w *WAL) CurrentSeq() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.curFile == nil {
+		return nil
+	}
+	return w.curFile.Close()
+}
+
+// Purge closes the WAL and permanently deletes its on-disk segment
+// directory.
+func (w *WAL) Purge() error {
+	w.mu.Lock()
+	dir := w.opts.Dir
+	if w.curFile != nil {
+		_ = w.curFile.Close()
+		w.curFile = nil
+	}
+	w.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// pruneLocked deletes whole segments that fall entirely before the
+// RetentionAge cutoff or once total on-disk size exceeds RetentionBytes.
+// The currently open segment is never removed. Must be called with w.mu held.
+func (w *WAL) pruneLocked() {
+	if w.opts.RetentionAge <= 0 && w.opts.RetentionBytes <= 0 {
+		return
+	}
+	cutoffSeq := int64(-1)
+	if w.opts.RetentionAge > 0 {
+		cutoff := time.Now().Add(-w.opts.RetentionAge)
+		for _, e := range w.index {
+			if e.Ts.Before(cutoff) {
+				cutoffSeq = e.Seq
+			} else {
+				break
+			}
+		}
+	}
+	if w.opts.RetentionBytes > 0 {
+		var total int64
+		for i := len(w.index) - 1; i >= 0; i-- {
+			total += int64(walRecordHeaderSize) + int64(w.index[i].Length)
+			if total > w.opts.RetentionBytes {
+				if w.index[i].Seq > cutoffSeq {
+					cutoffSeq = w.index[i].Seq
+				}
+				break
+			}
+		}
+	}
+	if cutoffSeq < 0 {
+		return
+	}
+	i := sort.Search(len(w.index), func(i int) bool { return w.index[i].Seq > cutoffSeq })
+	if i == 0 {
+		return
+	}
+	keepFromSegment := w.curNum
+	if i < len(w.index) {
+		keepFromSegment = w.index[i].Segment
+	}
+	for n := 1; n < keepFromSegment && n < w.curNum; n++ {
+		_ = os.Remove(w.segmentPath(n))
+	}
+	w.index = w.index[i:]
+}
+
+func (w *WAL) prune() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pruneLocked()
+}
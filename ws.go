@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// WSConn abstracts write & close for testability
+type WSConn interface {
+	Read(ctx context.Context) (ClientToServer, error)
+	Write(ctx context.Context, msg ServerToClient) error
+	Close(status websocket.StatusCode, reason string) error
+	SetReadLimit(n int64)
+}
+
+type nhooyrConn struct {
+	c *websocket.Conn
+}
+
+func (n *nhooyrConn) Read(ctx context.Context) (ClientToServer, error) {
+	var m ClientToServer
+	if err := wsjson.Read(ctx, n.c, &m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func (n *nhooyrConn) Write(ctx context.Context, msg ServerToClient) error {
+	return wsjson.Write(ctx, n.c, msg)
+}
+
+func (n *nhooyrConn) Close(status websocket.StatusCode, reason string) error {
+	return n.c.Close(status, reason)
+}
+
+func (n *nhooyrConn) SetReadLimit(nbytes int64) {
+	n.c.SetReadLimit(nbytes)
+}
+
+const (
+	// Backpressure policy: bounded queue per subscriber.
+	// If full, we DISCONNECT the subscriber with SLOW_CONSUMER.
+	// This keeps the system healthy and is simple to reason about.
+	heartbeatInterval = 20 * time.Second
+	readLimitBytes    = 1 << 20 // 1MB
+)
+
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	// --- API Key Auth Check for WebSocket ---
+	expected := getEnv("API_KEY", "")
+	if expected != "" { // auth is enabled only if env var is set
+		if r.Header.Get("X-API-Key") != expected {
+			// Reject before websocket upgrade
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("Unauthorized WebSocket: Missing or invalid X-API-Key"))
+			return
+		}
+	}
+
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols: negotiatedSubprotocols,
+	})
+	if err != nil {
+		log.Printf("accept err: %v", err)
+		return
+	}
+	conn := &nhooyrConn{c: c}
+	conn.SetReadLimit(readLimitBytes)
+	// connDefaultCodec is used by subscriptions that don't request a
+	// compression codec of their own via the "compression" field.
+	connDefaultCodec := codecByName(c.Subprotocol())
+
+	metrics.connectionOpened()
+	defer metrics.connectionClosed()
+
+	ctx := r.Context()
+	// writer cancel context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// heartbeat goroutine
+	go func() {
+		t := time.NewTicker(heartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				_ = conn.Write(context.Background(), ServerToClient{
+					Type: "info",
+					Msg:  "ping",
+					TS:   time.Now().UTC(),
+				})
+			}
+		}
+	}()
+
+	// per-connection state: subscriptions by topic -> *Subscriber
+	subs := map[string]*Subscriber{}
+
+	for {
+		var in ClientToServer
+		in, err = conn.Read(ctx)
+		if err != nil {
+			// connection closed or error
+			break
+		}
+		switch in.Type {
+		case "ping":
+			_ = conn.Write(ctx, ServerToClient{Type: "pong", RequestID: in.RequestID, TS: time.Now().UTC()})
+		case "subscribe":
+			if in.Topic == "" || in.ClientID == "" {
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "BAD_REQUEST", Message: "topic and client_id required"}, TS: time.Now().UTC()})
+				continue
+			}
+			topic, err := globalTopics.GetTopic(in.Topic)
+			if err != nil {
+				if globalTopics.wasRecentlyExpired(in.Topic) {
+					_ = conn.Write(ctx, ServerToClient{Type: "info", Topic: in.Topic, Msg: "topic_expired", TS: time.Now().UTC()})
+				}
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "TOPIC_NOT_FOUND", Message: "topic not found"}, TS: time.Now().UTC()})
+				continue
+			}
+			mode := in.DeliveryMode
+			if mode == "" {
+				mode = AtMostOnce
+			}
+			// codec selection: an explicit per-subscribe "compression" field
+			// overrides the codec negotiated at handshake time via the
+			// WebSocket subprotocol, if any.
+			codec := connDefaultCodec
+			if in.Compression != "" {
+				if c := codecByName(in.Compression); c != nil {
+					codec = c
+				}
+			}
+			// create subscriber
+			sub := &Subscriber{
+				id:     in.ClientID,
+				topic:  topic.name,
+				send:   make(chan Message, subscriberQueueSize),
+				conn:   conn,
+				closed: make(chan struct{}),
+				mode:   mode,
+				group:  in.Group,
+				codec:  codec,
+			}
+			// writer goroutine for this subscriber
+			go subscriberWriteLoop(ctx, topic.name, sub)
+
+			// register BEFORE replaying so that any message published
+			// concurrently with the replay below is queued on sub.send
+			// rather than lost; cursor then bounds the replay so that the
+			// same message isn't also delivered twice. The cursor MUST be
+			// snapshotted inside the same topic.mu critical section as the
+			// registration, not after: publishToTopic holds this same lock
+			// across its history.Append + fan-out, so reading the cursor
+			// while still holding the lock guarantees a message is either
+			// fully appended-and-fanned-out before we register (and thus
+			// belongs to the replay window) or not yet appended at all (and
+			// thus arrives only via live fan-out) -- never both.
+			topic.mu.Lock()
+			// if already subscribed, close old one; already holding topic.mu
+			// here, so this must be closeLocked, not Close (which would try
+			// to re-acquire it and deadlock).
+			if old, ok := topic.subscribers[sub.id]; ok {
+				old.closeLocked(topic)
+			}
+			topic.subscribers[sub.id] = sub
+			topic.last = time.Now()
+			cursor := topic.history.CurrentSeq()
+			topic.mu.Unlock()
+			subs[topic.name+"/"+sub.id] = sub
+
+			// optional replay: last_n takes precedence, then an explicit
+			// offset/timestamp catch-up.
+			var history []Message
+			switch {
+			case in.LastN > 0:
+				history = topic.history.LastN(in.LastN)
+			case in.FromSeq > 0:
+				history, _ = topic.history.From(in.FromSeq, 0)
+			case !in.FromTime.IsZero():
+				history, _ = topic.history.FromTime(in.FromTime, 0)
+			}
+		replay:
+			for _, m := range history {
+				if m.Seq > cursor {
+					continue // will be (or already was) delivered via live fan-out
+				}
+				select {
+				case sub.send <- m:
+				default:
+					// overflow during replay: disconnect
+					sub.CloseWithError("SLOW_CONSUMER", "replay overflow")
+					break replay
+				}
+			}
+
+			_ = conn.Write(ctx, ServerToClient{Type: "ack", RequestID: in.RequestID, Topic: topic.name, Status: "ok", TS: time.Now().UTC()})
+		case "unsubscribe":
+			if in.Topic == "" || in.ClientID == "" {
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "BAD_REQUEST", Message: "topic and client_id required"}, TS: time.Now().UTC()})
+				continue
+			}
+			if topic, err := globalTopics.GetTopic(in.Topic); err == nil {
+				topic.mu.Lock()
+				if sub, ok := topic.subscribers[in.ClientID]; ok {
+					sub.closeLocked(topic)
+				}
+				topic.mu.Unlock()
+			}
+			delete(subs, in.Topic+"/"+in.ClientID)
+			_ = conn.Write(ctx, ServerToClient{Type: "ack", RequestID: in.RequestID, Topic: in.Topic, Status: "ok", TS: time.Now().UTC()})
+		case "ack", "nack":
+			if in.Topic == "" || in.ClientID == "" {
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "BAD_REQUEST", Message: "topic and client_id required"}, TS: time.Now().UTC()})
+				continue
+			}
+			topic, err := globalTopics.GetTopic(in.Topic)
+			if err != nil {
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "TOPIC_NOT_FOUND", Message: "topic not found"}, TS: time.Now().UTC()})
+				continue
+			}
+			topic.mu.RLock()
+			sub, ok := topic.subscribers[in.ClientID]
+			topic.mu.RUnlock()
+			if ok {
+				if in.Type == "ack" {
+					sub.ack(in.Seq)
+				} else {
+					sub.nack(topic, in.Seq)
+				}
+			}
+		case "publish":
+			if in.Topic == "" || in.Message == nil {
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "BAD_REQUEST", Message: "topic and message required"}, TS: time.Now().UTC()})
+				continue
+			}
+			if err := publishToTopic(in.Topic, *in.Message); err != nil {
+				code := "INTERNAL"
+				if errors.Is(err, ErrTopicNotFound) {
+					code = "TOPIC_NOT_FOUND"
+				}
+				_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: code, Message: err.Error()}, TS: time.Now().UTC()})
+				continue
+			}
+			_ = conn.Write(ctx, ServerToClient{Type: "ack", RequestID: in.RequestID, Topic: in.Topic, Status: "ok", TS: time.Now().UTC()})
+		default:
+			_ = conn.Write(ctx, ServerToClient{Type: "error", RequestID: in.RequestID, Error: &ErrObj{Code: "BAD_REQUEST", Message: "unknown type"}, TS: time.Now().UTC()})
+		}
+	}
+
+	// cleanup: tear down every subscription this connection opened. Close
+	// removes each subscriber from its topic under topic.mu, so neither a
+	// publish nor the redelivery loop racing this disconnect can send on its
+	// now-closed channel.
+	for _, sub := range subs {
+		sub.Close()
+	}
+	_ = conn.Close(websocket.StatusNormalClosure, "bye")
+}
+
+func subscriberWriteLoop(ctx context.Context, topicName string, sub *Subscriber) {
+	// Writes events from sub.send to the socket as ServerToClient{type:"event"}.
+	// Exit when channel closes or context done.
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-sub.send:
+			if !ok {
+				return
+			}
+			out, encoding := encodeForSubscriber(sub, m)
+			err := sub.conn.Write(context.Background(), ServerToClient{
+				Type:     "event",
+				Topic:    topicName,
+				Message:  &out,
+				Encoding: encoding,
+				TS:       time.Now().UTC(),
+			})
+			if err != nil {
+				sub.Close()
+				return
+			}
+		}
+	}
+}
+
+func publishToTopic(topicName string, m Message) error {
+	start := time.Now()
+	defer func() { metrics.observePublishLatency(time.Since(start).Seconds()) }()
+
+	t, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		return err
+	}
+
+	// Append and fan-out happen under the same lock a subscriber takes to
+	// register itself and snapshot its replay cursor (see the "subscribe"
+	// case in wsHandler), so assigning a sequence number and deciding who's
+	// currently subscribed are atomic: a subscriber is either registered
+	// before this call (and gets m live) or not yet registered (and replays
+	// m from history), never both.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// record in history; this assigns the per-topic sequence number that
+	// replay and live delivery both use.
+	m, err = t.history.Append(m)
+	if err != nil {
+		return err
+	}
+	metrics.incCounter("messages_published", topicName)
+	// fan-out: broadcast to ungrouped subscribers, deliver once per
+	// consumer group via round-robin.
+	t.last = time.Now()
+	groups := map[string][]*Subscriber{}
+	for id, s := range t.subscribers {
+		if s.group != "" {
+			groups[s.group] = append(groups[s.group], s)
+			continue
+		}
+		select {
+		case s.send <- m:
+			if s.mode == AtLeastOnce {
+				s.trackPending(m)
+			}
+			metrics.incCounter("messages_delivered", topicName)
+		default:
+			// backpressure overflow: disconnect slow consumer. t.mu is
+			// already held by this function, so closeWithErrorLocked (which
+			// also removes id from t.subscribers) rather than
+			// CloseWithError, which would try to re-acquire it.
+			log.Printf("disconnecting slow consumer %s on topic %s", id, topicName)
+			s.closeWithErrorLocked(t, "SLOW_CONSUMER", "subscriber queue overflow")
+		}
+	}
+	for group, members := range groups {
+		if deliverToGroup(t, group, members, m) {
+			metrics.incCounter("messages_delivered", topicName)
+		} else {
+			log.Printf("no available member for group %s on topic %s; message seq=%d dropped", group, topicName, m.Seq)
+		}
+	}
+	t.msgCount++
+	return nil
+}
+
+// closeUnlocked is the idempotent core of subscriber teardown: it marks s
+// closed, stops its writer goroutine, and closes the underlying connection.
+// It does not touch topic.subscribers -- callers that know which topic s
+// belongs to must remove it from there under topic.mu (see closeLocked and
+// Close) so that a send racing the close always loses the subscribers-map
+// lookup instead of hitting a closed channel.
+func (s *Subscriber) closeUnlocked() {
+	select {
+	case <-s.closed:
+		return
+	default:
+		close(s.closed)
+	}
+	close(s.send) // end writer loop
+	_ = s.conn.Close(websocket.StatusNormalClosure, "subscriber closed")
+}
+
+// closeLocked removes s from t.subscribers and tears it down. The caller
+// must already hold t.mu for writing.
+func (s *Subscriber) closeLocked(t *Topic) {
+	if cur, ok := t.subscribers[s.id]; ok && cur == s {
+		delete(t.subscribers, s.id)
+	}
+	s.closeUnlocked()
+}
+
+// Close unregisters s from its topic (if still registered there) and tears
+// it down. Use this from anywhere that isn't already holding t.mu; callers
+// that do hold it (e.g. while iterating t.subscribers) must use closeLocked
+// instead, since Close would otherwise deadlock re-acquiring the same lock.
+func (s *Subscriber) Close() {
+	if t, err := globalTopics.GetTopic(s.topic); err == nil {
+		t.mu.Lock()
+		s.closeLocked(t)
+		t.mu.Unlock()
+		return
+	}
+	s.closeUnlocked()
+}
+
+// sendCloseError writes a terminal error frame to the subscriber. It does
+// not close anything itself.
+func (s *Subscriber) sendCloseError(code, reason string) {
+	if code == "SLOW_CONSUMER" {
+		metrics.incCounter("slow_consumer_disconnects", s.topic)
+	}
+	_ = s.conn.Write(context.Background(), ServerToClient{
+		Type:  "error",
+		Error: &ErrObj{Code: code, Message: reason},
+		TS:    time.Now().UTC(),
+	})
+}
+
+// CloseWithError sends a terminal error frame, then closes s as Close would.
+func (s *Subscriber) CloseWithError(code, reason string) {
+	s.sendCloseError(code, reason)
+	s.Close()
+}
+
+// closeWithErrorLocked is CloseWithError for a caller that already holds
+// t.mu for writing.
+func (s *Subscriber) closeWithErrorLocked(t *Topic, code, reason string) {
+	s.sendCloseError(code, reason)
+	s.closeLocked(t)
+}
+
+// Helpers for debugging JSON
+func debugJSON(v any) string {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
+
+func bad(msg string) error { return fmt.Errorf(msg) }
+
+var subscriberQueueSize = func() int {
+	if v := os.Getenv("SUBSCRIBER_QUEUE_SIZE"); v != "" {
+		if n, _ := strconv.Atoi(v); n > 0 {
+			return n
+		}
+	}
+	return 100
+}()
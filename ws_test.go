@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"nhooyr.io/websocket"
+)
+
+// fakeConn is a no-op WSConn for tests that need a Subscriber but never
+// actually read from or write to its connection.
+type fakeConn struct{}
+
+func (fakeConn) Read(ctx context.Context) (ClientToServer, error) {
+	<-ctx.Done()
+	return ClientToServer{}, ctx.Err()
+}
+func (fakeConn) Write(context.Context, ServerToClient) error { return nil }
+func (fakeConn) Close(websocket.StatusCode, string) error    { return nil }
+func (fakeConn) SetReadLimit(int64)                          {}
+
+// TestSubscribeReplayNoDuplicatesUnderConcurrentPublish exercises the race
+// closed by 4513ffc ("close replay/live-delivery race on subscribe"):
+// registering a subscriber and snapshotting its replay cursor must happen
+// in the same topic.mu critical section publishToTopic uses for its
+// Append + fan-out, so every message is delivered exactly once -- via
+// replay or live fan-out, never both and never neither.
+func TestSubscribeReplayNoDuplicatesUnderConcurrentPublish(t *testing.T) {
+	topicName := "race-" + randomID()
+	if err := globalTopics.CreateTopic(topicName, TopicOptions{}); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	defer func() { _ = globalTopics.DeleteTopic(topicName) }()
+	topic, err := globalTopics.GetTopic(topicName)
+	if err != nil {
+		t.Fatalf("GetTopic: %v", err)
+	}
+
+	const publishers = 4
+	const perPublisher = 20
+	const n = publishers * perPublisher // stays under RingBuffer's default 100-entry capacity
+
+	var wg sync.WaitGroup
+	wg.Add(publishers)
+	for p := 0; p < publishers; p++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				if err := publishToTopic(topicName, Message{Payload: i}); err != nil {
+					t.Errorf("publish: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Register partway through the burst -- exactly when this lands
+	// relative to the publishers above is what makes this a race test.
+	sub := &Subscriber{
+		id:     "sub-" + randomID(),
+		topic:  topicName,
+		send:   make(chan Message, n*2),
+		conn:   fakeConn{},
+		closed: make(chan struct{}),
+	}
+	topic.mu.Lock()
+	topic.subscribers[sub.id] = sub
+	cursor := topic.history.CurrentSeq()
+	topic.mu.Unlock()
+
+	wg.Wait()
+
+	replay, err := topic.history.From(1, 0)
+	if err != nil {
+		t.Fatalf("From: %v", err)
+	}
+
+	seen := map[int64]bool{}
+	for _, m := range replay {
+		if m.Seq > cursor {
+			continue // will be (or already was) delivered via live fan-out
+		}
+		if seen[m.Seq] {
+			t.Fatalf("duplicate seq=%d delivered via replay", m.Seq)
+		}
+		seen[m.Seq] = true
+	}
+drain:
+	for {
+		select {
+		case m := <-sub.send:
+			if seen[m.Seq] {
+				t.Fatalf("duplicate seq=%d delivered live after already seen via replay", m.Seq)
+			}
+			seen[m.Seq] = true
+		default:
+			break drain
+		}
+	}
+
+	if len(seen) != n {
+		t.Fatalf("expected exactly %d messages delivered via replay+live, got %d", n, len(seen))
+	}
+}